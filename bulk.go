@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// bulkCols are the spell columns BulkLoad stages and inserts, in the
+// order CopyIn expects them.
+var bulkCols = []string{"name", "level", "school", "cast_time", "duration",
+	"range", "comp_verbal", "comp_somatic", "comp_material", "material_desc",
+	"concentration", "ritual", "description", "source_id", "content_hash"}
+
+// BulkLoad seeds a freshly-reset Postgres database from src using
+// pq.CopyIn instead of one round trip per row: spells are streamed
+// into a temp staging table in batchSize-row chunks, moved into the
+// real spell table with a single INSERT ... SELECT ... RETURNING so
+// the new ids can be mapped back to class associations, and those
+// associations are copied in the same way. Everything runs inside one
+// transaction. This is Postgres-only since CopyIn is a lib/pq
+// extension; seedReset falls back to row-at-a-time inserts for other
+// drivers.
+// BulkLoad returns the new spell ids keyed by name, so callers that
+// need to attach more data to a spell post-insert (e.g. localization)
+// don't have to re-query for it.
+func BulkLoad(db *sqlx.DB, spells []Spell, classes map[SpellKey][]Class, batchSize int) (map[string]int, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`
+		CREATE TEMP TABLE spell_staging (
+			name text, level text, school text, cast_time text, duration text,
+			"range" text, comp_verbal boolean, comp_somatic boolean,
+			comp_material boolean, material_desc text, concentration boolean,
+			ritual boolean, description text, source_id int, content_hash text
+		) ON COMMIT DROP
+	`); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	hashed := make([]Spell, len(spells))
+	for i, s := range spells {
+		s.ContentHash.String = ContentHash(s, classIDsOf(classes[SpellKey(s.Name)]))
+		s.ContentHash.Valid = true
+		hashed[i] = s
+	}
+
+	if err := copySpellsInBatches(tx, "spell_staging", hashed, batchSize); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	spellIDs, err := moveStagedSpells(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	links := make([][2]int, 0, len(spells))
+	for _, s := range spells {
+		id, ok := spellIDs[s.Name]
+		if !ok {
+			continue
+		}
+		for _, c := range classes[SpellKey(s.Name)] {
+			links = append(links, [2]int{id, c.ID})
+		}
+	}
+
+	if err := copyClassSpellsInBatches(tx, links, batchSize); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return spellIDs, nil
+}
+
+// copySpellsInBatches streams spells into table via pq.CopyIn,
+// flushing every batchSize rows so a large compendium doesn't sit
+// entirely in one COPY buffer.
+func copySpellsInBatches(tx *sqlx.Tx, table string, spells []Spell, batchSize int) error {
+	for start := 0; start < len(spells); start += batchSize {
+		end := start + batchSize
+		if end > len(spells) {
+			end = len(spells)
+		}
+
+		stmt, err := tx.Prepare(pq.CopyIn(table, bulkCols...))
+		if err != nil {
+			return err
+		}
+		for _, s := range spells[start:end] {
+			if _, err := stmt.Exec(
+				s.Name, s.Level, s.School, s.CastTime, s.Duration, s.Range,
+				s.Verbal, s.Somatic, s.Material, s.MaterialDesc, s.Concentration,
+				s.Ritual, s.Description, s.SourceID, s.ContentHash,
+			); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		if _, err := stmt.Exec(); err != nil {
+			stmt.Close()
+			return err
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveStagedSpells inserts every row of spell_staging into spell and
+// returns the new ids keyed by spell name.
+func moveStagedSpells(tx *sqlx.Tx) (map[string]int, error) {
+	rows, err := tx.Queryx(`
+		INSERT INTO spell (name, level, school, cast_time, duration, "range",
+		comp_verbal, comp_somatic, comp_material, material_desc, concentration,
+		ritual, description, source_id, content_hash)
+		SELECT name, level, school, cast_time, duration, "range", comp_verbal,
+		comp_somatic, comp_material, material_desc, concentration, ritual,
+		description, source_id, content_hash
+		FROM spell_staging
+		RETURNING id, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]int{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		ids[name] = id
+	}
+	return ids, rows.Err()
+}
+
+// copyClassSpellsInBatches streams (spell_id, class_id) pairs into
+// class_spells via pq.CopyIn, batchSize rows at a time.
+func copyClassSpellsInBatches(tx *sqlx.Tx, links [][2]int, batchSize int) error {
+	for start := 0; start < len(links); start += batchSize {
+		end := start + batchSize
+		if end > len(links) {
+			end = len(links)
+		}
+
+		stmt, err := tx.Prepare(pq.CopyIn("class_spells", "spell_id", "class_id"))
+		if err != nil {
+			return err
+		}
+		for _, l := range links[start:end] {
+			if _, err := stmt.Exec(l[0], l[1]); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		if _, err := stmt.Exec(); err != nil {
+			stmt.Close()
+			return err
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/murder-hobos/mhinitdb/db/dialect"
+)
+
+// BenchmarkBulkLoad and BenchmarkRowAtATime compare BulkLoad against
+// the original per-row insert path. Both need a real Postgres
+// database with the spell/class_spells schema already applied; point
+// MHINITDB_TEST_DSN at a scratch database and run:
+//
+//	go test -run=^$ -bench=. -benchtime=1x
+//
+// They're skipped otherwise since there's no way to fake pq.CopyIn.
+func setupBenchDB(b *testing.B) *sqlx.DB {
+	dsn := os.Getenv("MHINITDB_TEST_DSN")
+	if dsn == "" {
+		b.Skip("set MHINITDB_TEST_DSN to a scratch postgres database to run this benchmark")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+func benchSpells(n int) ([]Spell, map[SpellKey][]Class) {
+	spells := make([]Spell, n)
+	classes := make(map[SpellKey][]Class, n)
+	for i := range spells {
+		spells[i] = Spell{
+			Name:        fmt.Sprintf("Bench Spell %d", i),
+			Level:       "1",
+			School:      "Evocation",
+			CastTime:    "1 action",
+			Duration:    "Instantaneous",
+			Range:       "60 feet",
+			Description: "A benchmark spell.",
+			SourceID:    PHBid,
+		}
+		classes[SpellKey(spells[i].Name)] = []Class{{ID: 1}}
+	}
+	return spells, classes
+}
+
+func truncateBenchTables(b *testing.B, db *sqlx.DB) {
+	if _, err := db.Exec(`TRUNCATE spell, class_spells RESTART IDENTITY CASCADE`); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	db := setupBenchDB(b)
+	defer db.Close()
+	spells, classes := benchSpells(500)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		truncateBenchTables(b, db)
+		if _, err := BulkLoad(db, spells, classes, 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRowAtATime(b *testing.B) {
+	db := setupBenchDB(b)
+	defer db.Close()
+	spells, classes := benchSpells(500)
+	dia := dialect.NewPostgres("")
+
+	cols := []string{"name", "level", "school", "cast_time", "duration", "range",
+		"comp_verbal", "comp_somatic", "comp_material", "material_desc",
+		"concentration", "ritual", "description", "source_id", "content_hash"}
+	insertSQL, _ := dia.InsertReturning("spell", cols, "id")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		truncateBenchTables(b, db)
+
+		insertSpell, err := db.PrepareNamed(insertSQL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		insertClassSpells, err := db.Preparex(db.Rebind(`INSERT INTO class_spells (spell_id, class_id) VALUES (?, ?)`))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		for _, s := range spells {
+			cs := classes[SpellKey(s.Name)]
+			s.ContentHash.String = ContentHash(s, classIDsOf(cs))
+			s.ContentHash.Valid = true
+
+			var spellID int
+			if err := insertSpell.QueryRowx(&s).Scan(&spellID); err != nil {
+				b.Fatal(err)
+			}
+			for _, c := range cs {
+				if _, err := insertClassSpells.Exec(spellID, c.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
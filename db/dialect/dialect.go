@@ -0,0 +1,63 @@
+// Package dialect abstracts the handful of places Postgres, SQLite,
+// and MySQL diverge enough that mhinitdb's seeding pipeline needs
+// driver-specific SQL, so the rest of the tool can work purely in
+// terms of a Dialect.
+package dialect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect captures one database backend's DDL and its dialect of
+// INSERT/identifier syntax.
+type Dialect interface {
+	// Name is the driver name as registered with database/sql, e.g.
+	// "postgres", "sqlite3", or "mysql".
+	Name() string
+	// SchemaSQL returns the DDL that creates the spell/class/
+	// class_spells tables (and friends) from scratch.
+	SchemaSQL() string
+	// QuoteIdent quotes ident in this dialect's identifier syntax, so
+	// reserved words like "range" can be used as column names.
+	QuoteIdent(ident string) string
+	// InsertReturning builds a named-parameter INSERT over cols and
+	// returns it alongside a second query that retrieves the new
+	// row's retCol. Postgres answers both in one statement via
+	// RETURNING, so its fetch query is empty; SQLite and MySQL only
+	// expose the last inserted id through a follow-up query
+	// (last_insert_rowid() / LAST_INSERT_ID()).
+	InsertReturning(table string, cols []string, retCol string) (insertSQL, fetchIDSQL string)
+}
+
+// namedInsert builds the column list and ":col" bind list shared by
+// every dialect's InsertReturning; only the RETURNING/fetch tail
+// differs between them.
+func namedInsert(d Dialect, table string, cols []string) (colList, bindList string) {
+	quoted := make([]string, len(cols))
+	binds := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = d.QuoteIdent(c)
+		binds[i] = ":" + c
+	}
+	return strings.Join(quoted, ", "), strings.Join(binds, ", ")
+}
+
+func insertSQL(d Dialect, table, colList, bindList string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, colList, bindList)
+}
+
+// ForName returns the Dialect registered under name (the value of the
+// -driver flag), or nil if there isn't one.
+func ForName(name, pgSchema string) Dialect {
+	switch name {
+	case "postgres":
+		return NewPostgres(pgSchema)
+	case "sqlite", "sqlite3":
+		return NewSQLite()
+	case "mysql":
+		return NewMySQL()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+package dialect
+
+import "testing"
+
+func TestQuoteIdent(t *testing.T) {
+	cases := []struct {
+		dia  Dialect
+		want string
+	}{
+		{NewPostgres(""), `"range"`},
+		{NewSQLite(), `"range"`},
+		{NewMySQL(), "`range`"},
+	}
+	for _, c := range cases {
+		if got := c.dia.QuoteIdent("range"); got != c.want {
+			t.Errorf("%s.QuoteIdent(\"range\") = %q, want %q", c.dia.Name(), got, c.want)
+		}
+	}
+}
+
+func TestInsertReturning(t *testing.T) {
+	cols := []string{"name", "range"}
+
+	insertSQL, fetchSQL := NewPostgres("").InsertReturning("spell", cols, "id")
+	wantInsert := `INSERT INTO spell ("name", "range") VALUES (:name, :range) RETURNING "id"`
+	if insertSQL != wantInsert {
+		t.Errorf("postgres insertSQL = %q, want %q", insertSQL, wantInsert)
+	}
+	if fetchSQL != "" {
+		t.Errorf("postgres fetchIDSQL = %q, want empty (uses RETURNING)", fetchSQL)
+	}
+
+	_, fetchSQL = NewSQLite().InsertReturning("spell", cols, "id")
+	if fetchSQL != "SELECT last_insert_rowid()" {
+		t.Errorf("sqlite fetchIDSQL = %q", fetchSQL)
+	}
+
+	_, fetchSQL = NewMySQL().InsertReturning("spell", cols, "id")
+	if fetchSQL != "SELECT LAST_INSERT_ID()" {
+		t.Errorf("mysql fetchIDSQL = %q", fetchSQL)
+	}
+}
+
+func TestForName(t *testing.T) {
+	if ForName("postgres", "") == nil {
+		t.Error("ForName(postgres) = nil")
+	}
+	if ForName("sqlite3", "") == nil {
+		t.Error("ForName(sqlite3) = nil")
+	}
+	if ForName("mysql", "") == nil {
+		t.Error("ForName(mysql) = nil")
+	}
+	if ForName("oracle", "") != nil {
+		t.Error("ForName(oracle) should be nil")
+	}
+}
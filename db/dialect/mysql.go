@@ -0,0 +1,74 @@
+package dialect
+
+// mysql targets a MySQL/MariaDB server.
+type mysql struct{}
+
+// NewMySQL returns the MySQL Dialect.
+func NewMySQL() Dialect {
+	return mysql{}
+}
+
+func (mysql) Name() string { return "mysql" }
+
+func (mysql) SchemaSQL() string { return mysqlSchema }
+
+func (mysql) QuoteIdent(ident string) string {
+	return "`" + ident + "`"
+}
+
+func (m mysql) InsertReturning(table string, cols []string, retCol string) (string, string) {
+	colList, bindList := namedInsert(m, table, cols)
+	return insertSQL(m, table, colList, bindList), "SELECT LAST_INSERT_ID()"
+}
+
+const mysqlSchema = `
+DROP TABLE IF EXISTS spell_translation;
+DROP TABLE IF EXISTS class_spells;
+DROP TABLE IF EXISTS spell;
+DROP TABLE IF EXISTS class;
+DROP TABLE IF EXISTS source;
+
+CREATE TABLE source (
+	id   INT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE class (
+	id            INT AUTO_INCREMENT PRIMARY KEY,
+	name          VARCHAR(255) NOT NULL,
+	base_class_id INT REFERENCES class(id),
+	source_id     INT NOT NULL REFERENCES source(id)
+);
+
+CREATE TABLE spell (
+	id            INT AUTO_INCREMENT PRIMARY KEY,
+	name          VARCHAR(255) NOT NULL,
+	level         VARCHAR(32) NOT NULL,
+	school        VARCHAR(64) NOT NULL,
+	cast_time     VARCHAR(64) NOT NULL,
+	duration      VARCHAR(64) NOT NULL,
+	` + "`range`" + ` VARCHAR(64) NOT NULL,
+	comp_verbal   BOOLEAN NOT NULL DEFAULT FALSE,
+	comp_somatic  BOOLEAN NOT NULL DEFAULT FALSE,
+	comp_material BOOLEAN NOT NULL DEFAULT FALSE,
+	material_desc TEXT,
+	concentration BOOLEAN NOT NULL DEFAULT FALSE,
+	ritual        BOOLEAN NOT NULL DEFAULT FALSE,
+	description   TEXT NOT NULL,
+	source_id     INT NOT NULL REFERENCES source(id),
+	content_hash  VARCHAR(64)
+) ENGINE=InnoDB;
+
+CREATE TABLE class_spells (
+	spell_id INT NOT NULL REFERENCES spell(id),
+	class_id INT NOT NULL REFERENCES class(id)
+) ENGINE=InnoDB;
+
+CREATE TABLE spell_translation (
+	spell_id INT NOT NULL REFERENCES spell(id),
+	lang     VARCHAR(35) NOT NULL,
+	field    VARCHAR(32) NOT NULL,
+	value    TEXT NOT NULL,
+	PRIMARY KEY (spell_id, lang, field)
+) ENGINE=InnoDB;
+`
@@ -0,0 +1,28 @@
+package dialect
+
+import "fmt"
+
+// postgres is the original dialect this tool was built against.
+type postgres struct {
+	schema string
+}
+
+// NewPostgres returns the Postgres Dialect. schema is the DDL to run
+// on reset, normally the bundled initial-pg.sql asset.
+func NewPostgres(schema string) Dialect {
+	return postgres{schema: schema}
+}
+
+func (p postgres) Name() string { return "postgres" }
+
+func (p postgres) SchemaSQL() string { return p.schema }
+
+func (p postgres) QuoteIdent(ident string) string {
+	return `"` + ident + `"`
+}
+
+func (p postgres) InsertReturning(table string, cols []string, retCol string) (string, string) {
+	colList, bindList := namedInsert(p, table, cols)
+	sql := insertSQL(p, table, colList, bindList) + fmt.Sprintf(" RETURNING %s", p.QuoteIdent(retCol))
+	return sql, ""
+}
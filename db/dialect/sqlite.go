@@ -0,0 +1,76 @@
+package dialect
+
+// sqlite targets a local SQLite file, primarily so the seeding
+// pipeline can be exercised in tests and CI without a Postgres
+// server.
+type sqlite struct{}
+
+// NewSQLite returns the SQLite Dialect.
+func NewSQLite() Dialect {
+	return sqlite{}
+}
+
+func (sqlite) Name() string { return "sqlite3" }
+
+func (sqlite) SchemaSQL() string { return sqliteSchema }
+
+func (sqlite) QuoteIdent(ident string) string {
+	return `"` + ident + `"`
+}
+
+func (s sqlite) InsertReturning(table string, cols []string, retCol string) (string, string) {
+	colList, bindList := namedInsert(s, table, cols)
+	return insertSQL(s, table, colList, bindList), "SELECT last_insert_rowid()"
+}
+
+const sqliteSchema = `
+DROP TABLE IF EXISTS spell_translation;
+DROP TABLE IF EXISTS class_spells;
+DROP TABLE IF EXISTS spell;
+DROP TABLE IF EXISTS class;
+DROP TABLE IF EXISTS source;
+
+CREATE TABLE source (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE class (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	name          TEXT NOT NULL,
+	base_class_id INTEGER REFERENCES class(id),
+	source_id     INTEGER NOT NULL REFERENCES source(id)
+);
+
+CREATE TABLE spell (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	name          TEXT NOT NULL,
+	level         TEXT NOT NULL,
+	school        TEXT NOT NULL,
+	cast_time     TEXT NOT NULL,
+	duration      TEXT NOT NULL,
+	"range"       TEXT NOT NULL,
+	comp_verbal   INTEGER NOT NULL DEFAULT 0,
+	comp_somatic  INTEGER NOT NULL DEFAULT 0,
+	comp_material INTEGER NOT NULL DEFAULT 0,
+	material_desc TEXT,
+	concentration INTEGER NOT NULL DEFAULT 0,
+	ritual        INTEGER NOT NULL DEFAULT 0,
+	description   TEXT NOT NULL,
+	source_id     INTEGER NOT NULL REFERENCES source(id),
+	content_hash  TEXT
+);
+
+CREATE TABLE class_spells (
+	spell_id INTEGER NOT NULL REFERENCES spell(id),
+	class_id INTEGER NOT NULL REFERENCES class(id)
+);
+
+CREATE TABLE spell_translation (
+	spell_id INTEGER NOT NULL REFERENCES spell(id),
+	lang     TEXT NOT NULL,
+	field    TEXT NOT NULL,
+	value    TEXT NOT NULL,
+	PRIMARY KEY (spell_id, lang, field)
+);
+`
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Translatable spell fields. The base Spell struct's shape doesn't
+// change for localization; these just name the columns that get a row
+// per language in spell_translation.
+const (
+	FieldName         = "name"
+	FieldDescription  = "description"
+	FieldMaterialDesc = "material_desc"
+)
+
+// catalogEntry is one spell's translatable strings in a single
+// language.
+type catalogEntry struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	MaterialDesc string `json:"material_desc,omitempty"`
+}
+
+// Catalog is a language's full translation catalog, keyed by the
+// spell's source-language (English) name so Merger can join it back
+// up to a spell id at seed time.
+type Catalog map[string]catalogEntry
+
+// Extractor walks parsed spells and emits one JSON catalog per
+// language under its Dir, seeded from the English strings so
+// translators have something to start from.
+type Extractor struct {
+	Dir string
+}
+
+// Extract writes Dir/<lang>.json for each of langs. An existing
+// catalog is left alone so a translator's in-progress work is never
+// clobbered by a re-run.
+func (e Extractor) Extract(spells []Spell, langs []string) error {
+	if err := os.MkdirAll(e.Dir, 0755); err != nil {
+		return err
+	}
+
+	catalog := make(Catalog, len(spells))
+	for _, s := range spells {
+		catalog[s.Name] = catalogEntry{
+			Name:         s.Name,
+			Description:  s.Description,
+			MaterialDesc: s.MaterialDesc.String,
+		}
+	}
+
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for _, lang := range langs {
+		path := filepath.Join(e.Dir, lang+".json")
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("writing %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// Merger reads translated catalogs back in at seed time and populates
+// spell_translation alongside the base row.
+type Merger struct {
+	Dir string
+}
+
+// Load reads Dir/<lang>.json for each of langs.
+func (m Merger) Load(langs []string) (map[string]Catalog, error) {
+	catalogs := make(map[string]Catalog, len(langs))
+	for _, lang := range langs {
+		path := filepath.Join(m.Dir, lang+".json")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", path, err)
+		}
+		var c Catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		catalogs[lang] = c
+	}
+	return catalogs, nil
+}
+
+// Merge inserts spell_translation rows for spellIDs (keyed by spell
+// name, as populated during seeding) from catalogs, inside tx.
+func (m Merger) Merge(tx *sqlx.Tx, spellIDs map[string]int, catalogs map[string]Catalog) error {
+	insert := tx.Rebind(`INSERT INTO spell_translation (spell_id, lang, field, value) VALUES (?, ?, ?, ?)`)
+
+	for lang, catalog := range catalogs {
+		for name, entry := range catalog {
+			id, ok := spellIDs[name]
+			if !ok {
+				continue // catalog has a spell that's no longer in the compendium
+			}
+
+			fields := map[string]string{
+				FieldName:        entry.Name,
+				FieldDescription: entry.Description,
+			}
+			if entry.MaterialDesc != "" {
+				fields[FieldMaterialDesc] = entry.MaterialDesc
+			}
+
+			for field, value := range fields {
+				if _, err := tx.Exec(insert, id, lang, field, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ensureSpellTranslationTable creates spell_translation if it isn't
+// already there, the same defensive way ensureContentHashColumn keeps
+// upsert/verify mode working against databases seeded before this
+// table existed.
+func ensureSpellTranslationTable(db *sqlx.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS spell_translation (
+			spell_id int NOT NULL REFERENCES spell(id),
+			lang     varchar(35) NOT NULL,
+			field    varchar(32) NOT NULL,
+			value    text NOT NULL,
+			PRIMARY KEY (spell_id, lang, field)
+		)
+	`)
+	return err
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/murder-hobos/mhinitdb/db/dialect"
+)
+
+// SeedMode controls how the tool reconciles the compendium against an
+// existing database.
+type SeedMode string
+
+const (
+	// ModeReset drops and recreates the schema before loading, as the
+	// tool has always done. Any existing data, including user data, is
+	// destroyed.
+	ModeReset SeedMode = "reset"
+	// ModeUpsert diffs incoming spells against spell.content_hash and
+	// only inserts, updates, or deletes the rows that changed, leaving
+	// the rest of the database untouched. Safe to run against a
+	// database with live user data.
+	ModeUpsert SeedMode = "upsert"
+	// ModeVerify performs the same diff as ModeUpsert but makes no
+	// writes. It is meant for CI: it exits non-zero if the database
+	// has drifted from the compendium.
+	ModeVerify SeedMode = "verify"
+)
+
+// ensureContentHashColumn adds spell.content_hash if it isn't already
+// there. It's defensive rather than relying solely on the bundled
+// schema SQL, so upsert/verify mode can be pointed at a database that
+// was created before this column existed.
+func ensureContentHashColumn(db *sqlx.DB, dia dialect.Dialect) error {
+	switch dia.Name() {
+	case "mysql":
+		// MySQL didn't support "ADD COLUMN IF NOT EXISTS" until 8.0.29;
+		// ignore the "duplicate column" error so this stays idempotent
+		// on older servers too.
+		_, err := db.Exec(`ALTER TABLE spell ADD COLUMN content_hash VARCHAR(64)`)
+		if err != nil && !isDuplicateColumn(err) {
+			return err
+		}
+		return nil
+	case "sqlite3":
+		// SQLite has no "ADD COLUMN IF NOT EXISTS" at all; same trick.
+		_, err := db.Exec(`ALTER TABLE spell ADD COLUMN content_hash text`)
+		if err != nil && !isDuplicateColumn(err) {
+			return err
+		}
+		return nil
+	default:
+		_, err := db.Exec(`ALTER TABLE spell ADD COLUMN IF NOT EXISTS content_hash text`)
+		return err
+	}
+}
+
+// isDuplicateColumn reports whether err is the "column already
+// exists" error MySQL or SQLite returns when content_hash has already
+// been added by a previous run.
+func isDuplicateColumn(err error) bool {
+	return err != nil && strings.Contains(strings.ToLower(err.Error()), "duplicate column")
+}
+
+// seedReferenceData inserts the small, fixed source/class lookup rows
+// that spell.source_id, class.source_id, and class_spells.class_id's
+// foreign keys point at. The bundled Postgres schema asset seeds these
+// as part of its own DDL; db/dialect's sqlite/mysql schemas only
+// create the tables, so do it here instead, right after a reset.
+func seedReferenceData(db *sqlx.DB, dia dialect.Dialect) error {
+	if dia.Name() == "postgres" {
+		return nil
+	}
+
+	sources := []struct {
+		ID   int
+		Name string
+	}{
+		{PHBid, "Player's Handbook"},
+		{EEid, "Elemental Evil"},
+		{SCAGid, "Sword Coast Adventurer's Guide"},
+	}
+	insertSource := db.Rebind(`INSERT INTO source (id, name) VALUES (?, ?)`)
+	for _, s := range sources {
+		if _, err := db.Exec(insertSource, s.ID, s.Name); err != nil {
+			return err
+		}
+	}
+
+	insertClass := db.Rebind(`INSERT INTO class (id, name, base_class_id, source_id) VALUES (?, ?, ?, ?)`)
+	for _, c := range Classes {
+		if _, err := db.Exec(insertClass, c.ID, c.Name, c.BaseClass, c.SourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContentHash computes a stable digest over a spell's fields and its
+// class associations. Two runs of the importer produce the same hash
+// for the same logical spell regardless of row order or DB-assigned
+// IDs, which is what lets upsert mode tell "unchanged" apart from
+// "needs update".
+func ContentHash(s Spell, classIDs []int) string {
+	sorted := append([]int(nil), classIDs...)
+	sort.Ints(sorted)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%t\x00%t\x00%t\x00%s\x00%t\x00%t\x00%s\x00%d",
+		s.Name, s.Level, s.School, s.CastTime, s.Duration, s.Range,
+		s.Verbal, s.Somatic, s.Material, s.MaterialDesc.String,
+		s.Concentration, s.Ritual, s.Description, s.SourceID)
+	for _, id := range sorted {
+		fmt.Fprintf(h, "\x00%d", id)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dbSpellHash is a row from the spell table, trimmed down to what
+// Loader needs to diff against incoming data.
+type dbSpellHash struct {
+	ID          int    `db:"id"`
+	Name        string `db:"name"`
+	ContentHash string `db:"content_hash"`
+}
+
+// Loader reconciles a parsed compendium against the spell/class_spells
+// tables according to a SeedMode.
+type Loader struct {
+	DB      *sqlx.DB
+	Dialect dialect.Dialect
+	Mode    SeedMode
+}
+
+// existingHashes loads every spell currently in the database, keyed by
+// name, so Diff can tell new spells from changed or unchanged ones.
+func (l *Loader) existingHashes() (map[string]dbSpellHash, error) {
+	rows := []dbSpellHash{}
+	// Rows seeded before content_hash existed hold NULL there; read
+	// them as "" so they diff as "update" instead of failing the scan.
+	if err := l.DB.Select(&rows, `SELECT id, name, COALESCE(content_hash, '') AS content_hash FROM spell`); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]dbSpellHash, len(rows))
+	for _, r := range rows {
+		byName[r.Name] = r
+	}
+	return byName, nil
+}
+
+// diffEntry is one spell's outcome from comparing the compendium
+// against the database.
+type diffEntry struct {
+	name   string
+	action string // "insert", "update", "delete", "unchanged"
+}
+
+// Diff compares parsed spells (and their class hashes) against the
+// database and reports what would change, without writing anything.
+// It's shared by upsert mode (which then applies the diff) and verify
+// mode (which just reports it).
+func (l *Loader) Diff(spells []Spell, classIDs map[string][]int) ([]diffEntry, error) {
+	existing, err := l.existingHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(spells))
+	entries := make([]diffEntry, 0, len(spells))
+
+	for _, s := range spells {
+		seen[s.Name] = true
+		hash := ContentHash(s, classIDs[s.Name])
+
+		row, ok := existing[s.Name]
+		switch {
+		case !ok:
+			entries = append(entries, diffEntry{name: s.Name, action: "insert"})
+		case row.ContentHash != hash:
+			entries = append(entries, diffEntry{name: s.Name, action: "update"})
+		default:
+			entries = append(entries, diffEntry{name: s.Name, action: "unchanged"})
+		}
+	}
+
+	for name := range existing {
+		if !seen[name] {
+			entries = append(entries, diffEntry{name: name, action: "delete"})
+		}
+	}
+
+	return entries, nil
+}
+
+// Apply writes the changes a prior Diff found, all inside a single
+// transaction so a failure partway through leaves the database as it
+// was.
+func (l *Loader) Apply(spells []Spell, classIDs map[string][]int, diff []diffEntry) error {
+	byName := make(map[string]Spell, len(spells))
+	for _, s := range spells {
+		byName[s.Name] = s
+	}
+
+	tx, err := l.DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	cols := []string{"name", "level", "school", "cast_time", "duration", "range",
+		"comp_verbal", "comp_somatic", "comp_material", "material_desc",
+		"concentration", "ritual", "description", "source_id", "content_hash"}
+	insertSQL, fetchIDSQL := l.Dialect.InsertReturning("spell", cols, "id")
+
+	insertSpell, err := tx.PrepareNamed(insertSQL)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, d := range diff {
+		switch d.action {
+		case "unchanged":
+			continue
+
+		case "delete":
+			var spellID int
+			row := tx.QueryRowx(tx.Rebind(`SELECT id FROM spell WHERE name = ?`), d.name)
+			if err := row.Scan(&spellID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.Exec(tx.Rebind(`DELETE FROM spell_translation WHERE spell_id = ?`), spellID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.Exec(tx.Rebind(`DELETE FROM class_spells WHERE spell_id = ?`), spellID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.Exec(tx.Rebind(`DELETE FROM spell WHERE id = ?`), spellID); err != nil {
+				tx.Rollback()
+				return err
+			}
+
+		case "insert":
+			s := byName[d.name]
+			s.ContentHash = sql.NullString{String: ContentHash(s, classIDs[d.name]), Valid: true}
+			spellID, err := l.insertSpellReturningID(tx, insertSpell, fetchIDSQL, &s)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := l.insertClassSpells(tx, spellID, classIDs[d.name]); err != nil {
+				tx.Rollback()
+				return err
+			}
+
+		case "update":
+			s := byName[d.name]
+			s.ContentHash = sql.NullString{String: ContentHash(s, classIDs[d.name]), Valid: true}
+			var spellID int
+			row := tx.QueryRowx(tx.Rebind(`SELECT id FROM spell WHERE name = ?`), d.name)
+			if err := row.Scan(&spellID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.NamedExec(fmt.Sprintf(`
+				UPDATE spell SET level = :level, school = :school, cast_time = :cast_time,
+				duration = :duration, %s = :range, comp_verbal = :comp_verbal,
+				comp_somatic = :comp_somatic, comp_material = :comp_material,
+				material_desc = :material_desc, concentration = :concentration,
+				ritual = :ritual, description = :description, source_id = :source_id,
+				content_hash = :content_hash
+				WHERE name = :name
+			`, l.Dialect.QuoteIdent("range")), &s); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if _, err := tx.Exec(tx.Rebind(`DELETE FROM class_spells WHERE spell_id = ?`), spellID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := l.insertClassSpells(tx, spellID, classIDs[d.name]); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertSpellReturningID runs stmt and reports the new row's id. When
+// the dialect answered with RETURNING, stmt's own query already
+// reports it; otherwise fetchIDSQL is a follow-up query run over the
+// same transaction (last_insert_rowid()/LAST_INSERT_ID() are
+// connection-scoped, which a single *sqlx.Tx guarantees).
+func (l *Loader) insertSpellReturningID(tx *sqlx.Tx, stmt *sqlx.NamedStmt, fetchIDSQL string, s *Spell) (int, error) {
+	var id int
+	if fetchIDSQL == "" {
+		err := stmt.QueryRowx(s).Scan(&id)
+		return id, err
+	}
+	if _, err := stmt.Exec(s); err != nil {
+		return 0, err
+	}
+	err := tx.QueryRowx(fetchIDSQL).Scan(&id)
+	return id, err
+}
+
+// insertClassSpells links spellID to each of classIDs inside tx.
+func (l *Loader) insertClassSpells(tx *sqlx.Tx, spellID int, classIDs []int) error {
+	q := tx.Rebind(`INSERT INTO class_spells (spell_id, class_id) VALUES (?, ?)`)
+	for _, classID := range classIDs {
+		if _, err := tx.Exec(q, spellID, classID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
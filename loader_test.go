@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/murder-hobos/mhinitdb/db/dialect"
+)
+
+// newTestDB returns an in-memory sqlite database with the dialect
+// schema applied and one source/class row seeded, enough for Loader
+// tests to insert spells against without tripping the schema's
+// foreign keys.
+func newTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(dialect.NewSQLite().SchemaSQL()); err != nil {
+		t.Fatalf("applying schema: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO source (id, name) VALUES (1, 'Player''s Handbook')`); err != nil {
+		t.Fatalf("seeding source: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO class (id, name, source_id) VALUES (1, 'Wizard', 1)`); err != nil {
+		t.Fatalf("seeding class: %v", err)
+	}
+	return db
+}
+
+func testSpell(name string) Spell {
+	return Spell{
+		Name:        name,
+		Level:       "0",
+		School:      "Evocation",
+		CastTime:    "1 action",
+		Duration:    "Instantaneous",
+		Range:       "120 feet",
+		Description: "test spell",
+		SourceID:    PHBid,
+	}
+}
+
+func TestLoaderDiffAndApply(t *testing.T) {
+	db := newTestDB(t)
+	loader := &Loader{DB: db, Dialect: dialect.NewSQLite(), Mode: ModeUpsert}
+
+	spells := []Spell{testSpell("Fire Bolt")}
+	classIDs := map[string][]int{"Fire Bolt": {1}}
+
+	diff, err := loader.Diff(spells, classIDs)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(diff) != 1 || diff[0].action != "insert" {
+		t.Fatalf("expected a single insert, got %+v", diff)
+	}
+
+	if err := loader.Apply(spells, classIDs, diff); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	var count int
+	if err := db.Get(&count, `SELECT count(*) FROM class_spells`); err != nil {
+		t.Fatalf("counting class_spells: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 class_spells row after insert, got %d", count)
+	}
+
+	// Re-diffing the same spell should report no drift.
+	diff, err = loader.Diff(spells, classIDs)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(diff) != 1 || diff[0].action != "unchanged" {
+		t.Fatalf("expected unchanged, got %+v", diff)
+	}
+
+	// Give the spell a translation, then drop it from the incoming
+	// compendium: Apply's "delete" case needs to cascade through both
+	// class_spells and spell_translation, or rows are left orphaned
+	// (or, with PRAGMA foreign_keys=ON, the delete fails outright).
+	if err := ensureSpellTranslationTable(db); err != nil {
+		t.Fatalf("ensureSpellTranslationTable: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO spell_translation (spell_id, lang, field, value)
+		SELECT id, 'de', 'name', 'Feuerpfeil' FROM spell WHERE name = 'Fire Bolt'
+	`); err != nil {
+		t.Fatalf("seeding translation: %v", err)
+	}
+
+	diff, err = loader.Diff(nil, nil)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if len(diff) != 1 || diff[0].action != "delete" {
+		t.Fatalf("expected a single delete, got %+v", diff)
+	}
+
+	if err := loader.Apply(nil, nil, diff); err != nil {
+		t.Fatalf("Apply (delete): %v", err)
+	}
+
+	for _, table := range []string{"spell", "class_spells", "spell_translation"} {
+		if err := db.Get(&count, `SELECT count(*) FROM `+table); err != nil {
+			t.Fatalf("counting %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("%s: expected 0 rows after delete, got %d", table, count)
+		}
+	}
+}
+
+func TestContentHashStableAcrossClassOrder(t *testing.T) {
+	s := testSpell("Fire Bolt")
+	a := ContentHash(s, []int{3, 1, 2})
+	b := ContentHash(s, []int{1, 2, 3})
+	if a != b {
+		t.Errorf("ContentHash should be order-independent over classIDs: %q != %q", a, b)
+	}
+
+	s2 := testSpell("Fire Bolt")
+	s2.Description = "a different description"
+	if ContentHash(s, []int{1}) == ContentHash(s2, []int{1}) {
+		t.Error("ContentHash should differ when a spell field changes")
+	}
+}
@@ -2,26 +2,39 @@ package main
 
 import (
 	"bytes"
-	"encoding/xml"
+	"database/sql"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/fatih/color"
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/murder-hobos/mhinitdb/db/dialect"
 	"github.com/murder-hobos/murder-hobos/db/initDb"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
 	user, passwd, host, port, dbname string
-	dropEverythingAndInitialize      string
-	xmlBytes                         []byte
+	mode                             string
+	source, path                     string
+	driver                           string
+	batchSize                        int
+	lang                             string
 	help                             bool
 )
 
+// i18nDir is where per-language translation catalogs are read from
+// and extracted to, relative to the working directory.
+const i18nDir = "data/i18n"
+
 const (
 	xmlFilePath = "data/Spells Compendium 1.2.1.xml"
 	sqlFilePath = "data/initial-pg.sql"
@@ -33,19 +46,130 @@ func init() {
 	flag.StringVar(&host, "h", "localhost", "Host name")
 	flag.StringVar(&port, "p", "5432", "Port number")
 	flag.StringVar(&dbname, "d", "", "Database name (required)")
+	flag.StringVar(&mode, "mode", string(ModeReset), "Seeding mode: reset|upsert|verify")
+	flag.StringVar(&source, "source", "bundled", "Compendium source: bundled|file|dir")
+	flag.StringVar(&path, "path", "", "Path to a compendium file or homebrew directory (required for -source=file|dir)")
+	flag.StringVar(&driver, "driver", "postgres", "Database driver: postgres|sqlite|mysql")
+	flag.IntVar(&batchSize, "batch-size", 500, "Rows per COPY batch when bulk-loading on Postgres")
+	flag.StringVar(&lang, "lang", "en", "Comma-separated BCP-47 language tags to load translation catalogs for, e.g. en,de,fr")
 	flag.BoolVar(&help, "help", false, "Displays this help")
+}
 
-	// Retrieve sql/xml info from bindata bundled with this executable
-	sqlBytes, err := initDb.Asset(sqlFilePath)
-	if err != nil {
-		log.Fatalln(err)
+// loadDialect builds the Dialect selected by -driver. Postgres keeps
+// using the bundled initial-pg.sql asset this tool has always shipped
+// with; sqlite and mysql carry their schema in db/dialect since there's
+// no bindata asset for them (yet).
+func loadDialect() dialect.Dialect {
+	pgSchema := ""
+	if driver == "postgres" {
+		sqlBytes, err := initDb.Asset(sqlFilePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		pgSchema = string(sqlBytes)
 	}
-	dropEverythingAndInitialize = string(sqlBytes)
 
-	xmlBytes, err = initDb.Asset(xmlFilePath)
-	if err != nil {
-		log.Fatalln(err)
+	dia := dialect.ForName(driver, pgSchema)
+	if dia == nil {
+		log.Fatalf("Error: unknown -driver %q, must be one of postgres|sqlite|mysql\n", driver)
+	}
+	return dia
+}
+
+// dsn builds the connection string sqlx.Connect expects for the
+// selected driver.
+func dsn() string {
+	switch driver {
+	case "postgres":
+		b := &bytes.Buffer{}
+		b.WriteString("user=")
+		b.WriteString(user)
+		b.WriteString(" dbname=")
+		b.WriteString(dbname)
+		b.WriteString(" password=")
+		b.WriteString(passwd)
+		b.WriteString(" host=")
+		b.WriteString(host)
+		b.WriteString(" port=")
+		b.WriteString(port)
+		b.WriteString(" sslmode=disable")
+		return b.String()
+
+	case "sqlite", "sqlite3":
+		// dbname doubles as the path to the sqlite file here.
+		return dbname
+
+	case "mysql":
+		b := &bytes.Buffer{}
+		b.WriteString(user)
+		if passwd != "" {
+			b.WriteString(":")
+			b.WriteString(passwd)
+		}
+		b.WriteString("@tcp(")
+		b.WriteString(host)
+		b.WriteString(":")
+		b.WriteString(port)
+		b.WriteString(")/")
+		b.WriteString(dbname)
+		return b.String()
 	}
+
+	log.Fatalf("Error: unknown -driver %q, must be one of postgres|sqlite|mysql\n", driver)
+	return ""
+}
+
+// loadSource builds the SpellSource selected by -source/-path. The
+// bundled compendium is always XML; -source=file sniffs the format
+// from the file extension, and -source=dir walks a homebrew directory
+// of mixed shards.
+func loadSource() SpellSource {
+	switch source {
+	case "bundled":
+		data, err := initDb.Asset(xmlFilePath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return XMLSource{Data: data}
+
+	case "file":
+		if path == "" {
+			log.Fatalln("Error: -path is required for -source=file")
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".xml":
+			return XMLSource{Data: data}
+		case ".json":
+			return JSONSource{Data: data}
+		default:
+			log.Fatalf("Error: don't know how to load %q, expected .xml or .json\n", path)
+		}
+
+	case "dir":
+		if path == "" {
+			log.Fatalln("Error: -path is required for -source=dir")
+		}
+		return DirSource{Path: path}
+	}
+
+	log.Fatalf("Error: unknown -source %q, must be one of bundled|file|dir\n", source)
+	return nil
+}
+
+// flagWasSet reports whether name was explicitly passed on the
+// command line, as opposed to just holding its default value.
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func confirm() bool {
@@ -81,7 +205,32 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
-	if !confirm() {
+
+	seedMode := SeedMode(mode)
+	switch seedMode {
+	case ModeReset, ModeUpsert, ModeVerify:
+	default:
+		fmt.Printf("Error: unknown -mode %q, must be one of reset|upsert|verify\n", mode)
+		os.Exit(1)
+	}
+
+	if batchSize <= 0 {
+		fmt.Printf("Error: -batch-size must be a positive number, got %d\n", batchSize)
+		os.Exit(1)
+	}
+
+	// seedLocalization only runs for ModeReset, since it needs the
+	// spell ids a full reset just assigned; upsert/verify have no
+	// equivalent path yet, so an explicit -lang there would silently
+	// do nothing.
+	if seedMode != ModeReset && flagWasSet("lang") {
+		fmt.Printf("Error: -lang is only supported with -mode=reset, not %q\n", mode)
+		os.Exit(1)
+	}
+
+	// Only reset mode is destructive; upsert/verify leave existing data
+	// alone, so there's nothing to confirm.
+	if seedMode == ModeReset && !confirm() {
 		os.Exit(1)
 	}
 
@@ -96,79 +245,239 @@ func main() {
 		fmt.Println()
 	}
 
-	b := &bytes.Buffer{}
-	b.WriteString("user=")
-	b.WriteString(user)
-	b.WriteString(" dbname=")
-	b.WriteString(dbname)
-	b.WriteString(" password=")
-	b.WriteString(passwd)
-	b.WriteString(" host=")
-	b.WriteString(host)
-	b.WriteString(" port=")
-	b.WriteString(port)
-	b.WriteString(" sslmode=disable")
-	db, err := sqlx.Connect("postgres", b.String())
+	dia := loadDialect()
+	db, err := sqlx.Connect(dia.Name(), dsn())
+	if err != nil {
+		log.Fatalln(err)
+	}
 
+	src := loadSource()
+	spells, classes, err := src.Spells()
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	if _, err := db.Exec(dropEverythingAndInitialize); err != nil {
+	switch seedMode {
+	case ModeReset:
+		spellIDs := seedReset(db, dia, spells, classes)
+		seedLocalization(db, spells, spellIDs, splitLangs(lang))
+	case ModeUpsert, ModeVerify:
+		seedUpsertOrVerify(db, dia, spells, classes, seedMode)
+	}
+}
+
+// splitLangs turns a comma-separated -lang value into trimmed tags.
+func splitLangs(lang string) []string {
+	parts := strings.Split(lang, ",")
+	langs := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			langs = append(langs, p)
+		}
+	}
+	return langs
+}
+
+// seedReset drops and recreates the schema, then inserts every spell
+// from the source fresh. This is the tool's original, destructive
+// behavior. It returns the new spell ids keyed by name.
+func seedReset(db *sqlx.DB, dia dialect.Dialect, spells []Spell, classes map[SpellKey][]Class) map[string]int {
+	if _, err := db.Exec(dia.SchemaSQL()); err != nil {
 		log.Fatalln(err)
 	}
 
-	// Have to be silly about this because range is a reserved word
-	insertSpell, err := db.PrepareNamed(`
-		INSERT INTO spell (name, level, school, cast_time, duration,
-		"range", comp_verbal, comp_somatic, comp_material, material_desc,
-        concentration, ritual, description, source_id)
-		VALUES
-		(:name, :level, :school, :cast_time, :duration, :range, :comp_verbal,
-        :comp_somatic, :comp_material, :material_desc, :concentration, :ritual,
-		:description, :source_id)
-        RETURNING id;
-	`)
+	// The bundled Postgres schema asset predates content_hash and isn't
+	// ours to edit, so every reset needs this the same defensive way
+	// upsert/verify mode does.
+	if err := ensureContentHashColumn(db, dia); err != nil {
+		log.Fatalln(err)
+	}
+
+	// sqlite/mysql's schema only creates the source/class tables; seed
+	// the fixed lookup rows their foreign keys need before any spell
+	// gets inserted.
+	if err := seedReferenceData(db, dia); err != nil {
+		log.Fatalln(err)
+	}
+
+	// Postgres can stream rows in via COPY instead of one round trip
+	// per spell; sqlite/mysql fall through to the row-at-a-time path
+	// below since CopyIn is a lib/pq extension.
+	if dia.Name() == "postgres" {
+		spellIDs, err := BulkLoad(db, spells, classes, batchSize)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return spellIDs
+	}
+
+	cols := []string{"name", "level", "school", "cast_time", "duration", "range",
+		"comp_verbal", "comp_somatic", "comp_material", "material_desc",
+		"concentration", "ritual", "description", "source_id", "content_hash"}
+	insertSQL, fetchIDSQL := dia.InsertReturning("spell", cols, "id")
+
+	// last_insert_rowid()/LAST_INSERT_ID() are connection-scoped, so the
+	// insert and the follow-up id fetch have to run over the same
+	// connection; a *sqlx.Tx is what guarantees that against a pool.
+	tx, err := db.Beginx()
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	insertClassSpells, err := db.Prepare(`
-		INSERT INTO class_spells (spell_id, class_id) VALUES ($1, $2);
-	`)
+	insertSpell, err := tx.PrepareNamed(insertSQL)
 	if err != nil {
+		tx.Rollback()
 		log.Fatalln(err)
 	}
 
-	var c initDb.Compendium
-	if err := xml.Unmarshal(xmlBytes, &c); err != nil {
+	insertClassSpells, err := tx.Preparex(tx.Rebind(`
+		INSERT INTO class_spells (spell_id, class_id) VALUES (?, ?);
+	`))
+	if err != nil {
+		tx.Rollback()
 		log.Fatalln(err)
 	}
 
-	// for each spell in our xml file
-	for _, xmlSpell := range c.XMLSpells {
-		s, err := xmlSpell.ToDbSpell()
-		if err != nil {
-			log.Fatalln("Error converting to db spell")
-		}
+	spellIDs := make(map[string]int, len(spells))
+	for _, s := range spells {
+		cs := classes[SpellKey(s.Name)]
+		s.ContentHash = sql.NullString{String: ContentHash(s, classIDsOf(cs)), Valid: true}
 
 		// Insert into spell table
-		var spellID int
-		err = insertSpell.QueryRowx(&s).Scan(&spellID)
-		//result, err := insertSpell.Exec(&s)
+		spellID, err := insertReturningID(tx, insertSpell, fetchIDSQL, &s)
 		if err != nil {
+			tx.Rollback()
 			log.Fatalln(err)
 		}
+		spellIDs[s.Name] = spellID
 
 		// Insert into class_spells table
-		if classes, ok := xmlSpell.ParseClasses(); ok {
-			for _, class := range classes {
-				if _, err := insertClassSpells.Exec(spellID, class.ID); err != nil {
-					log.Fatalln(err)
-				}
+		for _, class := range cs {
+			if _, err := insertClassSpells.Exec(spellID, class.ID); err != nil {
+				tx.Rollback()
+				log.Fatalln(err)
 			}
-		} else {
-			log.Fatalf("Error parsing classes from %v\n", xmlSpell)
 		}
 	}
+
+	if err := tx.Commit(); err != nil {
+		log.Fatalln(err)
+	}
+	return spellIDs
+}
+
+// seedLocalization extracts translation catalogs for langs (seeding
+// them from spells' English strings if they don't exist yet), then
+// merges those same langs' catalogs into spell_translation. Other
+// catalogs under i18nDir are not read.
+func seedLocalization(db *sqlx.DB, spells []Spell, spellIDs map[string]int, langs []string) {
+	if err := ensureSpellTranslationTable(db); err != nil {
+		log.Fatalln(err)
+	}
+
+	// seedReset just dropped and recreated spell, so every id in
+	// spellIDs is freshly assigned starting from scratch. The sqlite/
+	// mysql schemas drop spell_translation as part of that same reset,
+	// but the bundled Postgres schema asset doesn't know about this
+	// table, so old rows would otherwise keep referencing ids that are
+	// now reused by different spells. Clear it here so reset mode's
+	// "drop and recreate" semantics cover this table too.
+	if _, err := db.Exec(`DELETE FROM spell_translation`); err != nil {
+		log.Fatalln(err)
+	}
+
+	extractor := Extractor{Dir: i18nDir}
+	if err := extractor.Extract(spells, langs); err != nil {
+		log.Fatalln(err)
+	}
+
+	merger := Merger{Dir: i18nDir}
+	catalogs, err := merger.Load(langs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := merger.Merge(tx, spellIDs, catalogs); err != nil {
+		tx.Rollback()
+		log.Fatalln(err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// insertReturningID runs stmt (prepared from an InsertReturning SQL
+// string) and reports the new row's id. When the dialect answered
+// with RETURNING, stmt's own query already reports it; otherwise
+// fetchIDSQL is a follow-up query run over the same connection
+// (last_insert_rowid()/LAST_INSERT_ID() are connection-scoped, which
+// running both through tx rather than the bare pool guarantees).
+func insertReturningID(tx *sqlx.Tx, stmt *sqlx.NamedStmt, fetchIDSQL string, s *Spell) (int, error) {
+	var id int
+	if fetchIDSQL == "" {
+		err := stmt.QueryRowx(s).Scan(&id)
+		return id, err
+	}
+	if _, err := stmt.Exec(s); err != nil {
+		return 0, err
+	}
+	err := tx.QueryRowx(fetchIDSQL).Scan(&id)
+	return id, err
+}
+
+// seedUpsertOrVerify reconciles the source against an existing
+// database without dropping anything. In ModeVerify it only reports
+// drift and exits non-zero if it finds any.
+func seedUpsertOrVerify(db *sqlx.DB, dia dialect.Dialect, spells []Spell, classes map[SpellKey][]Class, mode SeedMode) {
+	// ModeVerify promises to make no writes (CI is its whole audience,
+	// often run against a read-only credential), so it can't issue this
+	// ALTER; it just has to assume content_hash already exists.
+	if mode != ModeVerify {
+		if err := ensureContentHashColumn(db, dia); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	classIDs := make(map[string][]int, len(spells))
+	for _, s := range spells {
+		classIDs[s.Name] = classIDsOf(classes[SpellKey(s.Name)])
+	}
+
+	loader := &Loader{DB: db, Dialect: dia, Mode: mode}
+	diff, err := loader.Diff(spells, classIDs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	changed := 0
+	for _, d := range diff {
+		if d.action == "unchanged" {
+			continue
+		}
+		changed++
+		fmt.Printf("%s: %s\n", d.action, d.name)
+	}
+
+	if mode == ModeVerify {
+		if changed > 0 {
+			fmt.Printf("%d spell(s) out of sync with the compendium\n", changed)
+			os.Exit(1)
+		}
+		fmt.Println("Database matches the compendium")
+		return
+	}
+
+	// Apply's "delete" case removes a spell's translations too, so the
+	// table needs to exist even if this database predates chunk0-5.
+	if err := ensureSpellTranslationTable(db); err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := loader.Apply(spells, classIDs, diff); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -50,6 +50,7 @@ type Spell struct {
 	Ritual        bool           `db:"ritual"`
 	Description   string         `db:"description"`
 	SourceID      int            `db:"source_id"`
+	ContentHash   sql.NullString `db:"content_hash"`
 }
 
 // Class represents our database Class table
@@ -98,8 +99,11 @@ type components struct {
 
 // ToDbSpell parses the data from `x` into a new Spell object
 // which it returns, along with an error. In the event of an error,
-// a zero-valued Spell is returned.
-func (x *XMLSpell) ToDbSpell() (Spell, error) {
+// a zero-valued Spell is returned. schoolMap resolves the xml file's
+// school abbreviation to its long form; callers outside of main's
+// bundled compendium can pass their own to support a source with a
+// different or extended set of schools.
+func (x *XMLSpell) ToDbSpell(schoolMap map[string]string) (Spell, error) {
 
 	// vars we need to do a little work for
 	// to convert
@@ -117,7 +121,7 @@ func (x *XMLSpell) ToDbSpell() (Spell, error) {
 	}
 
 	// We want the long version, not the abbreviation
-	if s, ok := schools[x.School]; ok {
+	if s, ok := schoolMap[x.School]; ok {
 		school = s
 	} else {
 		return Spell{}, errors.New("Not in schools map")
@@ -170,14 +174,15 @@ func (x *XMLSpell) ToDbSpell() (Spell, error) {
 
 // ParseClasses converts the XMLSpell's string of comma separated
 // classes into a slice of Class objects fully initialized with
-// ID and BaseClass values, ready to be inserted into our db.
-func (x *XMLSpell) ParseClasses() ([]Class, bool) {
+// ID and BaseClass values, ready to be inserted into our db. classMap
+// is keyed by class name, normally the package-level Classes map (see
+// classes.go), but callers can supply their own for a source that
+// defines classes the bundled compendium doesn't know about.
+func (x *XMLSpell) ParseClasses(classMap map[string]Class) ([]Class, bool) {
 	cs := []Class{}
 	split := strings.Split(x.Classes, ", ")
 	for _, s := range split {
-		// here Classes is a map found in classes.go
-		// not in this file because it's long and ugly
-		if c, ok := Classes[s]; ok {
+		if c, ok := classMap[s]; ok {
 			cs = append(cs, c)
 		} else {
 			return []Class{}, false
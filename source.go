@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SpellKey identifies a spell by name, used to associate a Spell with
+// its Class list across a SpellSource.
+type SpellKey string
+
+// SpellSource produces the spells and class associations to load into
+// the database. main only depends on this interface, so adding a new
+// compendium format is a matter of writing one of these rather than
+// touching the seeding pipeline.
+type SpellSource interface {
+	Spells() ([]Spell, map[SpellKey][]Class, error)
+}
+
+// classIDsOf extracts the IDs from a Class slice, since that's all
+// the seeding pipeline and content hash actually need.
+func classIDsOf(cs []Class) []int {
+	ids := make([]int, len(cs))
+	for i, c := range cs {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+//                          XML compendium source
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// XMLSource loads spells from the bundled "Spells Compendium" XML
+// format this tool has always shipped with. Schools and ClassMap
+// override the package-level schools/Classes maps school and class
+// names are resolved against; leave them nil to use the built-ins.
+type XMLSource struct {
+	Data     []byte
+	Schools  map[string]string
+	ClassMap map[string]Class
+}
+
+// Spells implements SpellSource.
+func (x XMLSource) Spells() ([]Spell, map[SpellKey][]Class, error) {
+	schoolMap := x.Schools
+	if schoolMap == nil {
+		schoolMap = schools
+	}
+	classMap := x.ClassMap
+	if classMap == nil {
+		classMap = Classes
+	}
+
+	var c Compendium
+	if err := xml.Unmarshal(x.Data, &c); err != nil {
+		return nil, nil, err
+	}
+
+	spells := make([]Spell, 0, len(c.XMLSpells))
+	classes := make(map[SpellKey][]Class, len(c.XMLSpells))
+	for _, xmlSpell := range c.XMLSpells {
+		s, err := xmlSpell.ToDbSpell(schoolMap)
+		if err != nil {
+			return nil, nil, fmt.Errorf("converting %q: %v", xmlSpell.Name, err)
+		}
+		cs, ok := xmlSpell.ParseClasses(classMap)
+		if !ok {
+			return nil, nil, fmt.Errorf("parsing classes for %q", xmlSpell.Name)
+		}
+		spells = append(spells, s)
+		classes[SpellKey(s.Name)] = cs
+	}
+	return spells, classes, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+//                    5e-tools / SRD JSON compendium source
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// jsonSpell mirrors the subset of the 5e-tools/SRD spell JSON schema
+// this loader understands: a flat array of spell objects, each with a
+// "classes.fromClassList[]" array of class names.
+type jsonSpell struct {
+	Name        string `json:"name"`
+	Level       string `json:"level"`
+	School      string `json:"school"`
+	Time        string `json:"time"`
+	Range       string `json:"range"`
+	Duration    string `json:"duration"`
+	Components  string `json:"components"`
+	Ritual      string `json:"ritual"`
+	Description string `json:"entries"`
+	Classes     struct {
+		FromClassList []struct {
+			Name string `json:"name"`
+		} `json:"fromClassList"`
+	} `json:"classes"`
+}
+
+// JSONSource loads spells from the 5e-tools/SRD style JSON format: an
+// array of spell objects rather than a single XML document. Schools
+// and ClassMap override the package-level schools/Classes maps school
+// and class names are resolved against; leave them nil to use the
+// built-ins.
+type JSONSource struct {
+	Data     []byte
+	Schools  map[string]string
+	ClassMap map[string]Class
+}
+
+// Spells implements SpellSource.
+func (j JSONSource) Spells() ([]Spell, map[SpellKey][]Class, error) {
+	schoolMap := j.Schools
+	if schoolMap == nil {
+		schoolMap = schools
+	}
+	classMap := j.ClassMap
+	if classMap == nil {
+		classMap = Classes
+	}
+
+	var raw []jsonSpell
+	if err := json.Unmarshal(j.Data, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	spells := make([]Spell, 0, len(raw))
+	classes := make(map[SpellKey][]Class, len(raw))
+	for _, js := range raw {
+		s, err := js.toDbSpell(schoolMap)
+		if err != nil {
+			return nil, nil, fmt.Errorf("converting %q: %v", js.Name, err)
+		}
+		cs, ok := js.parseClasses(classMap)
+		if !ok {
+			return nil, nil, fmt.Errorf("parsing classes for %q", js.Name)
+		}
+		spells = append(spells, s)
+		classes[SpellKey(s.Name)] = cs
+	}
+	return spells, classes, nil
+}
+
+// toDbSpell converts a jsonSpell into our database Spell, the JSON
+// counterpart to XMLSpell.ToDbSpell.
+func (j *jsonSpell) toDbSpell(schoolMap map[string]string) (Spell, error) {
+	school, ok := schoolMap[j.School]
+	if !ok {
+		return Spell{}, fmt.Errorf("%q not in schools map", j.School)
+	}
+
+	// Same "V, S, M (desc)" string format as the XML compendium.
+	comps := (&XMLSpell{Components: j.Components}).parseComponents()
+
+	return Spell{
+		Name:         j.Name,
+		Level:        j.Level,
+		School:       school,
+		CastTime:     j.Time,
+		Duration:     j.Duration,
+		Range:        j.Range,
+		Verbal:       comps.Verb,
+		Somatic:      comps.Som,
+		Material:     comps.Mat,
+		MaterialDesc: comps.Matdesc,
+		Ritual:       strings.EqualFold(j.Ritual, "YES"),
+		Description:  j.Description,
+		SourceID:     PHBid,
+	}, nil
+}
+
+// parseClasses resolves classes.fromClassList[] into our Class rows,
+// the JSON counterpart to XMLSpell.ParseClasses.
+func (j *jsonSpell) parseClasses(classMap map[string]Class) ([]Class, bool) {
+	cs := []Class{}
+	for _, fc := range j.Classes.FromClassList {
+		c, ok := classMap[fc.Name]
+		if !ok {
+			return []Class{}, false
+		}
+		cs = append(cs, c)
+	}
+	return cs, true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+//                       Homebrew directory source
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// DirSource walks a directory of *.xml/*.json shards, letting DMs add
+// homebrew spells without touching the bundled compendium. Each shard
+// is sniffed by extension and handed to the matching source above.
+// Schools and ClassMap are forwarded to every shard unchanged, so a
+// homebrew directory can define its own schools/classes by passing
+// maps that extend the built-ins.
+type DirSource struct {
+	Path     string
+	Schools  map[string]string
+	ClassMap map[string]Class
+}
+
+// Spells implements SpellSource.
+func (d DirSource) Spells() ([]Spell, map[SpellKey][]Class, error) {
+	spells := []Spell{}
+	classes := map[SpellKey][]Class{}
+
+	err := filepath.Walk(d.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		var shard SpellSource
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".xml":
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			shard = XMLSource{Data: data, Schools: d.Schools, ClassMap: d.ClassMap}
+		case ".json":
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			shard = JSONSource{Data: data, Schools: d.Schools, ClassMap: d.ClassMap}
+		default:
+			return nil // not a shard we recognize, skip it
+		}
+
+		ss, cs, err := shard.Spells()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		spells = append(spells, ss...)
+		for k, v := range cs {
+			classes[k] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return spells, classes, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func testSchools() map[string]string {
+	return map[string]string{"EV": "Evocation"}
+}
+
+func testClassMap() map[string]Class {
+	return map[string]Class{
+		"Wizard": {ID: 1, Name: "Wizard", SourceID: PHBid},
+	}
+}
+
+const testXML = `<compendium>
+	<spell>
+		<name>Fire Bolt</name>
+		<level>0</level>
+		<school>EV</school>
+		<ritual></ritual>
+		<time>1 action</time>
+		<range>120 feet</range>
+		<components>V, S</components>
+		<duration>Instantaneous</duration>
+		<classes>Wizard</classes>
+		<text>A mote of fire streaks toward a target.</text>
+	</spell>
+</compendium>`
+
+const testJSON = `[{
+	"name": "Fire Bolt",
+	"level": "0",
+	"school": "EV",
+	"time": "1 action",
+	"range": "120 feet",
+	"duration": "Instantaneous",
+	"components": "V, S",
+	"ritual": "",
+	"entries": "A mote of fire streaks toward a target.",
+	"classes": {"fromClassList": [{"name": "Wizard"}]}
+}]`
+
+func TestXMLSourceSpells(t *testing.T) {
+	src := XMLSource{Data: []byte(testXML), Schools: testSchools(), ClassMap: testClassMap()}
+	spells, classes, err := src.Spells()
+	if err != nil {
+		t.Fatalf("Spells() error: %v", err)
+	}
+	if len(spells) != 1 {
+		t.Fatalf("got %d spells, want 1", len(spells))
+	}
+	if s := spells[0]; s.Name != "Fire Bolt" || s.School != "Evocation" {
+		t.Fatalf("unexpected spell: %+v", s)
+	}
+	cs := classes[SpellKey("Fire Bolt")]
+	if len(cs) != 1 || cs[0].Name != "Wizard" {
+		t.Fatalf("unexpected classes: %+v", cs)
+	}
+}
+
+func TestXMLSourceUnknownSchool(t *testing.T) {
+	src := XMLSource{Data: []byte(testXML), Schools: map[string]string{}, ClassMap: testClassMap()}
+	if _, _, err := src.Spells(); err == nil {
+		t.Fatal("expected an error for a school not in Schools, got nil")
+	}
+}
+
+func TestJSONSourceSpells(t *testing.T) {
+	src := JSONSource{Data: []byte(testJSON), Schools: testSchools(), ClassMap: testClassMap()}
+	spells, classes, err := src.Spells()
+	if err != nil {
+		t.Fatalf("Spells() error: %v", err)
+	}
+	if len(spells) != 1 || spells[0].School != "Evocation" {
+		t.Fatalf("unexpected spells: %+v", spells)
+	}
+	if len(classes[SpellKey("Fire Bolt")]) != 1 {
+		t.Fatalf("unexpected classes: %+v", classes)
+	}
+}
+
+func TestDirSourceSpells(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "core.xml"), []byte(testXML), 0644); err != nil {
+		t.Fatalf("writing xml shard: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "srd.json"), []byte(testJSON), 0644); err != nil {
+		t.Fatalf("writing json shard: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a shard"), 0644); err != nil {
+		t.Fatalf("writing unrelated file: %v", err)
+	}
+
+	src := DirSource{Path: dir, Schools: testSchools(), ClassMap: testClassMap()}
+	spells, classes, err := src.Spells()
+	if err != nil {
+		t.Fatalf("Spells() error: %v", err)
+	}
+	if len(spells) != 2 {
+		t.Fatalf("got %d spells, want 2 (one per shard)", len(spells))
+	}
+	if len(classes[SpellKey("Fire Bolt")]) != 1 {
+		t.Fatalf("unexpected classes: %+v", classes)
+	}
+}